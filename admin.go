@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	pollsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "go_rancher_gen",
+		Name:      "polls_total",
+		Help:      "Total number of metadata polls performed.",
+	})
+
+	templateEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "go_rancher_gen",
+		Name:      "template_events_total",
+		Help:      "Total template lifecycle events, by outcome (processed, unchanged, check_failed, notify_failed).",
+	}, []string{"event"})
+
+	metadataFetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "go_rancher_gen",
+		Name:      "metadata_fetch_duration_seconds",
+		Help:      "Time spent fetching and assembling the template context from the metadata provider.",
+	})
+
+	checkDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "go_rancher_gen",
+		Name:      "check_duration_seconds",
+		Help:      "Time spent running CheckCmd.",
+	})
+
+	notifyDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "go_rancher_gen",
+		Name:      "notify_duration_seconds",
+		Help:      "Time spent running NotifyCmd.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pollsTotal, templateEventsTotal, metadataFetchDuration, checkDuration, notifyDuration)
+}
+
+// AdminServer exposes /metrics, /healthz, /templates, and POST /reload.
+type AdminServer struct {
+	runner *runner
+}
+
+// NewAdminServer builds an AdminServer backed by r. It is not started
+// until ListenAndServe is called.
+func NewAdminServer(r *runner) *AdminServer {
+	return &AdminServer{runner: r}
+}
+
+// ListenAndServe starts the admin HTTP server on addr (e.g. ":9100") and
+// blocks, in the style of net/http.ListenAndServe.
+func (s *AdminServer) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/templates", s.handleTemplates)
+	mux.HandleFunc("/reload", s.handleReload)
+
+	log.Infof("Starting admin server on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (s *AdminServer) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	age, polled := s.runner.lastPollAge()
+
+	body := map[string]interface{}{"last_poll_age_seconds": nil}
+	status := http.StatusServiceUnavailable
+
+	if polled {
+		body["last_poll_age_seconds"] = age.Seconds()
+
+		maxAge := s.runner.Config.HealthzMaxAge
+		if maxAge <= 0 || age <= maxAge {
+			status = http.StatusOK
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *AdminServer) handleTemplates(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.runner.templateSnapshot())
+}
+
+func (s *AdminServer) handleReload(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Info("Forced reload requested via admin API")
+	s.runner.forceReload()
+
+	go func() {
+		if err := s.runner.poll(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
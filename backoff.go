@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially increasing delays, with jitter, between
+// retries of a failing operation. It mirrors the bounded backoff drone's
+// agent uses against a flaky build server, capped by a configurable
+// RetryLimit so a permanently unreachable metadata endpoint doesn't retry
+// forever.
+type Backoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Jitter     float64
+	RetryLimit int
+
+	attempt int
+}
+
+// NewBackoff builds a Backoff from Config, falling back to sane defaults
+// (1s base, 30s max, 20% jitter, unlimited retries) when unset.
+func NewBackoff(conf *Config) *Backoff {
+	b := &Backoff{
+		Base:       conf.BackoffBase,
+		Max:        conf.BackoffMax,
+		Jitter:     conf.BackoffJitter,
+		RetryLimit: conf.RetryLimit,
+	}
+
+	if b.Base <= 0 {
+		b.Base = time.Second
+	}
+	if b.Max <= 0 {
+		b.Max = 30 * time.Second
+	}
+	if b.Jitter <= 0 {
+		b.Jitter = 0.2
+	}
+
+	return b
+}
+
+// Next returns the delay to wait before the next attempt, and false once
+// RetryLimit has been exhausted (RetryLimit <= 0 means unlimited).
+func (b *Backoff) Next() (time.Duration, bool) {
+	if b.RetryLimit > 0 && b.attempt >= b.RetryLimit {
+		return 0, false
+	}
+
+	delay := b.Base << uint(b.attempt)
+	if delay <= 0 || delay > b.Max {
+		delay = b.Max
+	}
+	b.attempt++
+
+	jitter := time.Duration(float64(delay) * b.Jitter * (rand.Float64()*2 - 1))
+	delay += jitter
+	if delay < 0 {
+		delay = b.Base
+	}
+
+	return delay, true
+}
+
+// Reset clears the attempt counter after a successful call, so the next
+// failure starts backing off from Base again.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNextGrowsExponentiallyAndCapsAtMax(t *testing.T) {
+	b := &Backoff{Base: time.Second, Max: 8 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i, w := range want {
+		delay, ok := b.Next()
+		if !ok {
+			t.Fatalf("attempt %d: Next() returned ok=false, want true", i)
+		}
+		if delay != w {
+			t.Errorf("attempt %d: Next() = %s, want %s", i, delay, w)
+		}
+	}
+}
+
+func TestBackoffNextRespectsRetryLimit(t *testing.T) {
+	b := &Backoff{Base: time.Second, Max: time.Minute, RetryLimit: 2}
+
+	if _, ok := b.Next(); !ok {
+		t.Fatal("attempt 1: Next() returned ok=false, want true")
+	}
+	if _, ok := b.Next(); !ok {
+		t.Fatal("attempt 2: Next() returned ok=false, want true")
+	}
+	if _, ok := b.Next(); ok {
+		t.Fatal("attempt 3: Next() returned ok=true, want false after exhausting RetryLimit")
+	}
+}
+
+func TestBackoffResetRestartsFromBase(t *testing.T) {
+	b := &Backoff{Base: time.Second, Max: 8 * time.Second}
+
+	b.Next()
+	b.Next()
+	b.Reset()
+
+	delay, ok := b.Next()
+	if !ok {
+		t.Fatal("Next() after Reset returned ok=false, want true")
+	}
+	if delay != time.Second {
+		t.Errorf("Next() after Reset = %s, want %s (Base)", delay, time.Second)
+	}
+}
+
+func TestBackoffNextJitterStaysWithinBounds(t *testing.T) {
+	b := &Backoff{Base: time.Second, Max: time.Minute, Jitter: 0.5}
+
+	for i := 0; i < 50; i++ {
+		b.Reset()
+		delay, ok := b.Next()
+		if !ok {
+			t.Fatal("Next() returned ok=false, want true")
+		}
+		if delay < time.Second/2 || delay > 3*time.Second/2 {
+			t.Fatalf("Next() = %s, want within [%s, %s]", delay, time.Second/2, 3*time.Second/2)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lSyslog "github.com/Sirupsen/logrus/hooks/syslog"
+	graylog "gopkg.in/gemnasium/logrus-graylog-hook.v2"
+)
+
+// syslogFacilities maps the facility names accepted in Config.Logging.Syslog
+// to their syslog.Priority, the same set log/syslog exposes.
+var syslogFacilities = map[string]syslog.Priority{
+	"KERN": syslog.LOG_KERN, "USER": syslog.LOG_USER, "MAIL": syslog.LOG_MAIL,
+	"DAEMON": syslog.LOG_DAEMON, "AUTH": syslog.LOG_AUTH, "SYSLOG": syslog.LOG_SYSLOG,
+	"LPR": syslog.LOG_LPR, "NEWS": syslog.LOG_NEWS, "UUCP": syslog.LOG_UUCP,
+	"CRON": syslog.LOG_CRON, "AUTHPRIV": syslog.LOG_AUTHPRIV, "FTP": syslog.LOG_FTP,
+	"LOCAL0": syslog.LOG_LOCAL0, "LOCAL1": syslog.LOG_LOCAL1, "LOCAL2": syslog.LOG_LOCAL2,
+	"LOCAL3": syslog.LOG_LOCAL3, "LOCAL4": syslog.LOG_LOCAL4, "LOCAL5": syslog.LOG_LOCAL5,
+	"LOCAL6": syslog.LOG_LOCAL6, "LOCAL7": syslog.LOG_LOCAL7,
+}
+
+// ConfigureLogging wires Config.Logging into logrus: a JSON formatter and
+// optional hooks shipping log entries to syslog or Graylog.
+func ConfigureLogging(conf *Config) error {
+	logging := conf.Logging
+
+	if logging.JSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+
+	if logging.Syslog.Network != "" {
+		facility := strings.ToUpper(logging.Syslog.Facility)
+		if facility == "" {
+			facility = "LOCAL0"
+		}
+
+		priority, ok := syslogFacilities[facility]
+		if !ok {
+			return fmt.Errorf("Unknown syslog facility: %s", logging.Syslog.Facility)
+		}
+
+		hook, err := lSyslog.NewSyslogHook(logging.Syslog.Network, logging.Syslog.Address, priority|syslog.LOG_INFO, "go-rancher-gen")
+		if err != nil {
+			return fmt.Errorf("Failed to initialize syslog hook: %v", err)
+		}
+		log.AddHook(hook)
+	}
+
+	if logging.Graylog.Address != "" {
+		log.AddHook(graylog.NewGraylogHook(logging.Graylog.Address, map[string]interface{}{
+			"facility": "go-rancher-gen",
+		}))
+	}
+
+	return nil
+}
+
+// logTemplateEvent emits a structured template lifecycle event (processed,
+// unchanged, check_failed, notify_failed) with the fields operators need to
+// alert on without parsing free text: which template, which destination,
+// which container triggered it, how long it took, and (for a failure) the
+// command's exit code.
+func logTemplateEvent(event string, t Template, container string, duration time.Duration, exitCode int, err error) {
+	fields := log.Fields{
+		"event":           event,
+		"template.source": t.Source,
+		"template.dest":   t.Dest,
+		"duration_ms":     duration.Nanoseconds() / int64(time.Millisecond),
+	}
+
+	if container != "" {
+		fields["container.name"] = container
+	}
+
+	entry := log.WithFields(fields)
+	if err != nil {
+		entry.WithField("exit_code", exitCode).WithField("error", err.Error()).Warn(event)
+	} else {
+		entry.Info(event)
+	}
+
+	templateEventsTotal.WithLabelValues(event).Inc()
+}
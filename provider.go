@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+)
+
+// MetadataProvider abstracts the source of service-discovery data so that
+// runner no longer has to talk to Rancher Metadata directly. Each provider
+// is responsible for translating its own native model into the Host,
+// Container, Service and Self types used by templates.
+type MetadataProvider interface {
+	// GetVersion returns an opaque token that changes whenever the
+	// underlying data set changes. It is cheap to call and is polled
+	// (or streamed) on every tick.
+	GetVersion() (string, error)
+
+	GetServices() ([]Service, error)
+	GetContainers() ([]Container, error)
+	GetHosts() ([]Host, error)
+	GetSelfContainer() (Self, error)
+}
+
+// StreamingProvider is an optional capability a MetadataProvider can
+// implement to support push-based updates instead of fixed-interval
+// polling. WaitForChange blocks until the provider's version differs from
+// currentVersion, or until its own internal timeout elapses, whichever
+// comes first; implementations should return promptly so the caller can
+// re-issue the wait (or fall back to ticking) on error.
+type StreamingProvider interface {
+	WaitForChange(currentVersion string) (string, error)
+}
+
+// NewMetadataProvider builds the MetadataProvider selected by
+// Config.Provider ("rancher" by default), pointed at Config.ProviderEndpoint.
+func NewMetadataProvider(conf *Config) (MetadataProvider, error) {
+	switch conf.Provider {
+	case "", "rancher":
+		return NewRancherProvider(conf)
+	case "consul":
+		return NewConsulProvider(conf)
+	case "etcd":
+		return NewEtcdProvider(conf)
+	default:
+		return nil, fmt.Errorf("Unknown metadata provider: %s", conf.Provider)
+	}
+}
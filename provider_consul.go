@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulProvider drives templates from Consul's catalog and health API
+// instead of Rancher Metadata; the KV store is not read. Catalog nodes map
+// to Host, catalog service
+// instances map to Container, and the set of instances sharing a service
+// name is aggregated into a Service, mirroring how Rancher groups
+// containers under a service.
+type ConsulProvider struct {
+	client *api.Client
+}
+
+// NewConsulProvider builds a ConsulProvider pointed at Config.ProviderEndpoint
+// (defaulting to the local agent at 127.0.0.1:8500).
+func NewConsulProvider(conf *Config) (*ConsulProvider, error) {
+	cfg := api.DefaultConfig()
+	if conf.ProviderEndpoint != "" {
+		cfg.Address = conf.ProviderEndpoint
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize Consul client: %v", err)
+	}
+
+	return &ConsulProvider{client: client}, nil
+}
+
+func (p *ConsulProvider) GetVersion() (string, error) {
+	_, meta, err := p.client.Catalog().Nodes(nil)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d", meta.LastIndex), nil
+}
+
+func (p *ConsulProvider) GetHosts() ([]Host, error) {
+	nodes, _, err := p.client.Catalog().Nodes(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]Host, 0, len(nodes))
+	for _, n := range nodes {
+		hosts = append(hosts, Host{
+			UUID:     n.ID,
+			Name:     n.Node,
+			Address:  n.Address,
+			Hostname: n.Node,
+			Labels:   LabelMap(n.Meta),
+		})
+	}
+
+	return hosts, nil
+}
+
+func (p *ConsulProvider) GetContainers() ([]Container, error) {
+	hosts, err := p.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	services, _, err := p.client.Catalog().Services(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0)
+	for name := range services {
+		// Health().Service(), unlike Catalog().Service(), returns the
+		// health checks alongside each instance so Container.Health can
+		// be populated.
+		entries, _, err := p.client.Health().Service(name, "", false, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			container := Container{
+				Name:    entry.Service.ID,
+				Address: entry.Service.Address,
+				Service: entry.Service.Service,
+				Health:  entry.Checks.AggregatedStatus(),
+				Labels:  LabelMap(entry.Service.Meta),
+			}
+			if container.Address == "" {
+				container.Address = entry.Node.Address
+			}
+			for _, h := range hosts {
+				if h.Name == entry.Node.Node {
+					container.Host = h
+					break
+				}
+			}
+			containers = append(containers, container)
+		}
+	}
+
+	return containers, nil
+}
+
+func (p *ConsulProvider) GetServices() ([]Service, error) {
+	containers, err := p.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	names, _, err := p.client.Catalog().Services(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0, len(names))
+	for name, tags := range names {
+		service := Service{
+			Name:   name,
+			Kind:   "consul",
+			Labels: LabelMap(map[string]string{}),
+		}
+		if len(tags) > 0 {
+			service.Labels["tags"] = fmt.Sprintf("%v", tags)
+		}
+
+		svcContainers := make([]Container, 0)
+		for _, c := range containers {
+			if c.Service == name {
+				svcContainers = append(svcContainers, c)
+			}
+		}
+		service.Containers = svcContainers
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (p *ConsulProvider) GetSelfContainer() (Self, error) {
+	agent, err := p.client.Agent().Self()
+	if err != nil {
+		return Self{}, err
+	}
+
+	// NodeID, not NodeName, matches what GetHosts uses for Host.UUID.
+	config, _ := agent["Config"].(map[string]interface{})
+	nodeID, _ := config["NodeID"].(string)
+
+	return Self{HostUUID: nodeID}, nil
+}
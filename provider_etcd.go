@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+)
+
+// etcdPrefix is the key namespace providers registered under, e.g.
+// /go-rancher-gen/hosts/<uuid>, /go-rancher-gen/containers/<name>.
+const etcdPrefix = "/go-rancher-gen/"
+
+// EtcdProvider drives templates from a JSON-encoded key space in etcd v3,
+// typically populated by a sidecar registrator. Each key's value is
+// unmarshalled directly into the matching Host/Container/Service type.
+type EtcdProvider struct {
+	client *clientv3.Client
+}
+
+// NewEtcdProvider builds an EtcdProvider connected to the comma-separated
+// endpoints in Config.ProviderEndpoint (defaulting to 127.0.0.1:2379).
+func NewEtcdProvider(conf *Config) (*EtcdProvider, error) {
+	endpoint := conf.ProviderEndpoint
+	if endpoint == "" {
+		endpoint = "127.0.0.1:2379"
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoint, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize etcd client: %v", err)
+	}
+
+	return &EtcdProvider{client: client}, nil
+}
+
+func (p *EtcdProvider) GetVersion() (string, error) {
+	resp, err := p.client.Get(context.Background(), etcdPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d", resp.Header.Revision), nil
+}
+
+func (p *EtcdProvider) getPrefix(sub string, dest interface{}) error {
+	resp, err := p.client.Get(context.Background(), etcdPrefix+sub, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	values := make([]json.RawMessage, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values = append(values, json.RawMessage(kv.Value))
+	}
+
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, dest)
+}
+
+func (p *EtcdProvider) GetHosts() ([]Host, error) {
+	hosts := make([]Host, 0)
+	if err := p.getPrefix("hosts/", &hosts); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+func (p *EtcdProvider) GetContainers() ([]Container, error) {
+	hosts, err := p.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0)
+	if err := p.getPrefix("containers/", &containers); err != nil {
+		return nil, err
+	}
+
+	for i, c := range containers {
+		for _, h := range hosts {
+			if h.UUID == c.Host.UUID && c.Host.UUID != "" {
+				containers[i].Host = h
+				break
+			}
+		}
+	}
+
+	return containers, nil
+}
+
+func (p *EtcdProvider) GetServices() ([]Service, error) {
+	containers, err := p.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0)
+	if err := p.getPrefix("services/", &services); err != nil {
+		return nil, err
+	}
+
+	for i, s := range services {
+		svcContainers := make([]Container, 0)
+		for _, c := range containers {
+			if c.Stack == s.Stack && c.Service == s.Name {
+				svcContainers = append(svcContainers, c)
+			}
+		}
+		services[i].Containers = svcContainers
+	}
+
+	return services, nil
+}
+
+func (p *EtcdProvider) GetSelfContainer() (Self, error) {
+	resp, err := p.client.Get(context.Background(), etcdPrefix+"self")
+	if err != nil {
+		return Self{}, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return Self{}, fmt.Errorf("No self container registered at %s", etcdPrefix+"self")
+	}
+
+	self := Self{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, &self); err != nil {
+		return Self{}, err
+	}
+
+	return self, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher-metadata/metadata"
+)
+
+// rancherLongPollMaxWait bounds how long a single /version long-poll
+// request is allowed to hang before we retry it, so a dropped connection
+// doesn't wedge WaitForChange forever.
+const rancherLongPollMaxWait = 60 * time.Second
+
+// RancherProvider is the original MetadataProvider, backed by the Rancher
+// Metadata service. It preserves the exact translation behavior runner used
+// to perform inline in createContext.
+type RancherProvider struct {
+	Client     metadata.Client
+	versionURL string
+	httpClient *http.Client
+}
+
+// NewRancherProvider dials the Rancher Metadata endpoint configured by
+// Config.ProviderEndpoint (defaulting to MetadataURL) and waits for it to
+// become available.
+func NewRancherProvider(conf *Config) (*RancherProvider, error) {
+	endpoint := conf.ProviderEndpoint
+	if endpoint == "" {
+		endpoint = MetadataURL
+	}
+
+	u, _ := url.Parse(endpoint)
+	u.Path = path.Join(u.Path, conf.MetadataVersion)
+
+	log.Infof("Initializing Rancher Metadata client (version %s)", conf.MetadataVersion)
+
+	client, err := metadata.NewClientAndWait(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize Rancher Metadata client: %v", err)
+	}
+
+	versionURL := u.String()
+	if !strings.HasSuffix(versionURL, "/") {
+		versionURL += "/"
+	}
+	versionURL += "version"
+
+	return &RancherProvider{
+		Client:     client,
+		versionURL: versionURL,
+		httpClient: &http.Client{Timeout: rancherLongPollMaxWait + 5*time.Second},
+	}, nil
+}
+
+// WaitForChange long-polls Rancher Metadata's /version endpoint, which
+// blocks server-side until the metadata version advances past
+// currentVersion or rancherLongPollMaxWait elapses.
+func (p *RancherProvider) WaitForChange(currentVersion string) (string, error) {
+	u := fmt.Sprintf("%s?wait=true&value=%s&maxWait=%d",
+		p.versionURL, url.QueryEscape(currentVersion), int(rancherLongPollMaxWait.Seconds()))
+
+	resp, err := p.httpClient.Get(u)
+	if err != nil {
+		return "", fmt.Errorf("Long-poll request to %s failed: %v", p.versionURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Long-poll request to %s returned status %d: %s", p.versionURL, resp.StatusCode, body)
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (p *RancherProvider) GetVersion() (string, error) {
+	return p.Client.GetVersion()
+}
+
+func (p *RancherProvider) GetHosts() ([]Host, error) {
+	metaHosts, err := p.Client.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]Host, 0)
+	for _, h := range metaHosts {
+		hosts = append(hosts, Host{
+			UUID:     h.UUID,
+			Name:     h.Name,
+			Address:  h.AgentIP,
+			Hostname: h.Hostname,
+			Labels:   LabelMap(h.Labels),
+		})
+	}
+
+	return hosts, nil
+}
+
+func (p *RancherProvider) GetContainers() ([]Container, error) {
+	hosts, err := p.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	metaContainers, err := p.Client.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0)
+	for _, c := range metaContainers {
+		container := Container{
+			Name:    c.Name,
+			Address: c.PrimaryIp,
+			Stack:   c.StackName,
+			Service: c.ServiceName,
+			Health:  c.HealthState,
+			State:   c.State,
+			Labels:  LabelMap(c.Labels),
+		}
+		for _, h := range hosts {
+			if h.UUID == c.HostUUID {
+				container.Host = h
+				break
+			}
+		}
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+func (p *RancherProvider) GetServices() ([]Service, error) {
+	containers, err := p.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	metaServices, err := p.Client.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0)
+	for _, s := range metaServices {
+		service := Service{
+			Name:     s.Name,
+			Stack:    s.StackName,
+			Kind:     s.Kind,
+			Vip:      s.Vip,
+			Fqdn:     s.Fqdn,
+			Labels:   LabelMap(s.Labels),
+			Metadata: MetadataMap(s.Metadata),
+		}
+		svcContainers := make([]Container, 0)
+		for _, c := range containers {
+			if c.Stack == s.StackName && c.Service == s.Name {
+				svcContainers = append(svcContainers, c)
+			}
+		}
+		service.Containers = svcContainers
+		service.Ports = parseServicePorts(s.Ports)
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (p *RancherProvider) GetSelfContainer() (Self, error) {
+	metaSelf, err := p.Client.GetSelfContainer()
+	if err != nil {
+		return Self{}, err
+	}
+
+	return Self{
+		Stack:    metaSelf.StackName,
+		Service:  metaSelf.ServiceName,
+		HostUUID: metaSelf.HostUUID,
+	}, nil
+}
@@ -2,25 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
-	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"text/template"
 	"time"
-        "regexp"
-	"github.com/fatih/structs"
+
+	"github.com/hashicorp/go-multierror"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/rancher/go-rancher-metadata/metadata"
 )
 
 var (
@@ -28,42 +27,161 @@ var (
 )
 
 type runner struct {
-	Config  *Config
-	Client  metadata.Client
-	Version string
+	Config   *Config
+	Provider MetadataProvider
+	Version  string
+	Backoff  *Backoff
 
 	quitChan chan os.Signal
-}
+	done     chan struct{}
 
-func NewRunner(conf *Config) (*runner, error) {
-	u, _ := url.Parse(MetadataURL)
-	u.Path = path.Join(u.Path, conf.MetadataVersion)
+	pollMu sync.Mutex
 
-	log.Infof("Initializing Rancher Metadata client (version %s)", conf.MetadataVersion)
+	statusMu       sync.RWMutex
+	lastPollTime   time.Time
+	templateStatus map[string]*TemplateStatus
+}
 
-	client, err := metadata.NewClientAndWait(u.String())
+func NewRunner(conf *Config) (*runner, error) {
+	provider, err := NewMetadataProvider(conf)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to initialize Rancher Metadata client: %v", err)
+		return nil, err
 	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	done := make(chan struct{})
+	go func() {
+		signal := <-c
+		log.Info("Exit requested by signal: ", signal)
+		close(done)
+	}()
+
 	return &runner{
-		Config:   conf,
-		Client:   client,
-		Version:  "init",
-		quitChan: c,
+		Config:         conf,
+		Provider:       provider,
+		Version:        "init",
+		Backoff:        NewBackoff(conf),
+		quitChan:       c,
+		done:           done,
+		templateStatus: make(map[string]*TemplateStatus),
 	}, nil
 }
 
+// TemplateStatus is the /templates admin-endpoint view of one configured
+// template: the version of metadata it was last rendered against and the
+// checksum of what was written (or would have been written, if unchanged).
+type TemplateStatus struct {
+	Source       string    `json:"source"`
+	Dest         string    `json:"dest"`
+	LastVersion  string    `json:"last_version"`
+	Checksum     string    `json:"checksum"`
+	LastRendered time.Time `json:"last_rendered"`
+}
+
+func (r *runner) recordTemplateStatus(t Template, checksum string) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	r.templateStatus[t.Source] = &TemplateStatus{
+		Source:       t.Source,
+		Dest:         t.Dest,
+		LastVersion:  r.Version,
+		Checksum:     checksum,
+		LastRendered: time.Now(),
+	}
+}
+
+// templateSnapshot returns the current status of every template that has
+// rendered at least once, for the /templates admin endpoint.
+func (r *runner) templateSnapshot() []*TemplateStatus {
+	r.statusMu.RLock()
+	defer r.statusMu.RUnlock()
+
+	statuses := make([]*TemplateStatus, 0, len(r.templateStatus))
+	for _, s := range r.templateStatus {
+		statuses = append(statuses, s)
+	}
+
+	return statuses
+}
+
+// lastPollAge reports how long ago poll() last completed successfully, and
+// whether a poll has ever completed, for the /healthz admin endpoint's
+// liveness check. polled is false before the first poll() finishes, so the
+// caller doesn't mistake "never polled" for "just polled".
+func (r *runner) lastPollAge() (age time.Duration, polled bool) {
+	r.statusMu.RLock()
+	defer r.statusMu.RUnlock()
+
+	if r.lastPollTime.IsZero() {
+		return 0, false
+	}
+
+	return time.Since(r.lastPollTime), true
+}
+
+// forceReload clears the cached Metadata version so the next poll() always
+// re-renders every template, regardless of whether Metadata actually
+// changed. Used by the admin server's POST /reload. It shares pollMu with
+// poll() so a reload can't land on r.Version while a ticker/push-triggered
+// poll is already in flight.
+func (r *runner) forceReload() {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+	r.Version = ""
+}
+
+// currentVersion, backoffNext and backoffReset let runPush touch r.Version
+// and r.Backoff under pollMu without holding it across a poll() call, so
+// push mode can't race poll()/forceReload() for these fields the way a bare
+// r.Version/r.Backoff access would.
+func (r *runner) currentVersion() string {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+	return r.Version
+}
+
+func (r *runner) backoffNext() (time.Duration, bool) {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+	return r.Backoff.Next()
+}
+
+func (r *runner) backoffReset() {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+	r.Backoff.Reset()
+}
+
 func (r *runner) Run() error {
+	if r.Config.Listen != "" {
+		admin := NewAdminServer(r)
+		go func() {
+			if err := admin.ListenAndServe(r.Config.Listen); err != nil {
+				log.Errorf("Admin server stopped: %v", err)
+			}
+		}()
+	}
+
 	if r.Config.OneTime {
 		log.Info("Processing all templates once.")
 		return r.poll()
 	}
 
-	log.Info("Polling Metadata with %d second interval", r.Config.Interval)
+	if r.Config.Push {
+		if streamer, ok := r.Provider.(StreamingProvider); ok {
+			return r.runPush(streamer)
+		}
+		log.Warn("Provider does not support push updates; falling back to interval polling")
+	}
+
+	return r.runPoll()
+}
+
+func (r *runner) runPoll() error {
+	log.Infof("Polling Metadata with %d second interval", r.Config.Interval)
 	ticker := time.NewTicker(time.Duration(r.Config.Interval) * time.Second)
 	defer ticker.Stop()
 	for {
@@ -73,40 +191,116 @@ func (r *runner) Run() error {
 
 		select {
 		case <-ticker.C:
-		case signal := <-r.quitChan:
-			log.Info("Exit requested by signal: ", signal)
+		case <-r.done:
 			return nil
 		}
 	}
 }
 
+// maxStreamFailures is how many consecutive WaitForChange errors runPush
+// tolerates before giving up on the stream and falling back to runPoll's
+// ticker, rather than backing off against it forever.
+const maxStreamFailures = 5
+
+// runPush drives poll() off a long-poll/websocket stream instead of a fixed
+// ticker, backing off (capped by Config.RetryLimit) whenever the stream
+// itself errors out, and falling back to interval polling once the stream
+// has failed maxStreamFailures times in a row.
+func (r *runner) runPush(streamer StreamingProvider) error {
+	log.Info("Streaming Metadata changes (push mode)")
+
+	if err := r.poll(); err != nil {
+		log.Error(err)
+	}
+
+	failures := 0
+	for {
+		select {
+		case <-r.done:
+			return nil
+		default:
+		}
+
+		newVersion, err := streamer.WaitForChange(r.currentVersion())
+		if err != nil {
+			failures++
+			if failures >= maxStreamFailures {
+				log.Warnf("Stream connection failed %d times in a row, falling back to interval polling: %v", failures, err)
+				return r.runPoll()
+			}
+
+			delay, ok := r.backoffNext()
+			if !ok {
+				return fmt.Errorf("Giving up streaming updates after exhausting retry limit: %v", err)
+			}
+			log.Warnf("Stream connection failed, retrying in %s: %v", delay, err)
+
+			select {
+			case <-time.After(delay):
+			case <-r.done:
+				return nil
+			}
+			continue
+		}
+		failures = 0
+		r.backoffReset()
+
+		if newVersion == r.currentVersion() {
+			continue
+		}
+
+		if err := r.poll(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// poll holds pollMu for its entire duration so a forced reload from the
+// admin server can never overlap a ticker/push-triggered poll and run
+// processTemplates twice concurrently.
 func (r *runner) poll() error {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+
+	pollsTotal.Inc()
+
 	log.Debug("Checking for metadata change")
-	newVersion, err := r.Client.GetVersion()
+	newVersion, err := r.Provider.GetVersion()
 	if err != nil {
-		time.Sleep(time.Second * 2)
+		delay, ok := r.Backoff.Next()
+		if !ok {
+			return fmt.Errorf("Failed to get Metadata version after exhausting retries: %v", err)
+		}
+		r.interruptibleSleep(delay)
 		return fmt.Errorf("Failed to get Metadata version: %v", err)
 	}
+	r.Backoff.Reset()
 
 	if r.Version == newVersion {
 		log.Debug("No changes in Metadata")
+		r.markPollSucceeded()
 		return nil
 	}
 
 	log.Debugf("Old version: %s, New Version: %s", r.Version, newVersion)
 
 	r.Version = newVersion
+	fetchStart := time.Now()
 	ctx, err := r.createContext()
 	if err != nil {
-		time.Sleep(time.Second * 2)
+		delay, ok := r.Backoff.Next()
+		if !ok {
+			return fmt.Errorf("Failed to create context from Rancher Metadata after exhausting retries: %v", err)
+		}
+		r.interruptibleSleep(delay)
 		return fmt.Errorf("Failed to create context from Rancher Metadata: %v", err)
 	}
+	metadataFetchDuration.Observe(time.Since(fetchStart).Seconds())
+	r.Backoff.Reset()
 
 	tmplFuncs := newFuncMap(ctx)
-	for _, tmpl := range r.Config.Templates {
-		if err := r.processTemplate(tmplFuncs, tmpl); err != nil {
-			return err
-		}
+	if err := r.processTemplates(ctx, tmplFuncs); err != nil {
+		return err
 	}
 
 	if r.Config.OneTime {
@@ -115,31 +309,96 @@ func (r *runner) poll() error {
 		log.Info("All templates processed. Waiting for changes in Metadata...")
 	}
 
+	r.markPollSucceeded()
 	return nil
 }
 
-func (r *runner) processTemplate(funcs template.FuncMap, t Template) error {
+func (r *runner) markPollSucceeded() {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.lastPollTime = time.Now()
+}
+
+// interruptibleSleep waits out delay, or returns early if an exit signal
+// has been received, so a backoff wait never delays shutdown by up to
+// Config.BackoffMax.
+func (r *runner) interruptibleSleep(delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-r.done:
+	}
+}
+
+// processTemplates fans the configured templates out across a pool of
+// Config.MaxProcs workers (default 1, i.e. serial) so that one slow
+// check/notify command no longer blocks every other template until the
+// next tick. Per-template failures are isolated and aggregated into a
+// single multierror instead of aborting the whole poll.
+func (r *runner) processTemplates(ctx *TemplateContext, funcs template.FuncMap) error {
+	maxProcs := r.Config.MaxProcs
+	if maxProcs <= 0 {
+		maxProcs = 1
+	}
+
+	jobs := make(chan Template)
+	results := make(chan error, len(r.Config.Templates))
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxProcs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				results <- r.processTemplate(ctx, funcs, t)
+			}
+		}()
+	}
+
+	go func() {
+		for _, t := range r.Config.Templates {
+			jobs <- t
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var errs *multierror.Error
+	for err := range results {
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (r *runner) processTemplate(ctx *TemplateContext, funcs template.FuncMap, t Template) error {
+	start := time.Now()
 
 	if (t.Source != "") && (t.Dest != "") {
 		log.Debugf("Processing template %s for destination %s", t.Source, t.Dest)
 		if _, err := os.Stat(t.Source); os.IsNotExist(err) {
-			log.Fatalf("Template '%s' is missing", t.Source)
+			return fmt.Errorf("Template '%s' is missing", t.Source)
 		}
 
 		tmplBytes, err := ioutil.ReadFile(t.Source)
 		if err != nil {
-			log.Fatalf("Could not read template '%s': %v", t.Source, err)
+			return fmt.Errorf("Could not read template '%s': %v", t.Source, err)
 		}
 
 		name := filepath.Base(t.Source)
 		newTemplate, err := template.New(name).Funcs(funcs).Parse(string(tmplBytes))
 		if err != nil {
-			log.Fatalf("Could not parse template '%s': %v", t.Source, err)
+			return fmt.Errorf("Could not parse template '%s': %v", t.Source, err)
 		}
 
 		buf := new(bytes.Buffer)
 		if err := newTemplate.Execute(buf, nil); err != nil {
-			log.Fatalf("Could not render template: '%s': %v", t.Source, err)
+			return fmt.Errorf("Could not render template: '%s': %v", t.Source, err)
 		}
 
 		content := buf.Bytes()
@@ -158,6 +417,8 @@ func (r *runner) processTemplate(funcs template.FuncMap, t Template) error {
 
 		if same {
 			log.Debugf("Destination %s is up to date", t.Dest)
+			r.recordTemplateStatus(t, checksumOf(content))
+			logTemplateEvent("unchanged", t, "", time.Since(start), 0, nil)
 			return nil
 		}
 
@@ -174,6 +435,8 @@ func (r *runner) processTemplate(funcs template.FuncMap, t Template) error {
 		}
 
 		log.Info("Destination file has been updated: ", t.Dest)
+		r.recordTemplateStatus(t, checksumOf(content))
+		logTemplateEvent("processed", t, "", time.Since(start), 0, nil)
 
 		defer os.Remove(stagingFile)
 
@@ -183,131 +446,63 @@ func (r *runner) processTemplate(funcs template.FuncMap, t Template) error {
 	}
 
 	if t.NotifyLbl == "" {
-			// Basic check/notify command, no label group
-			r.runCheckNotify(t, "", "");
-		} else {
-			// Possible multi-container check/notify from label group
-			toNotify, _ := r.getLabelGroup(t.NotifyLbl)
-
-			for _, c := range toNotify {
-				log.Debugf("Parsing: %+v", c.Name)
-				parsedCheck, _ := parseCmdTemplate(c, t.CheckCmd)
-				parsedNotify, _ := parseCmdTemplate(c, t.NotifyCmd)
-
-				err := r.runCheckNotify(t, parsedCheck, parsedNotify);
-				if err != nil {
-					fmt.Errorf("Check notification failed for check: %v\nnotify: %v\nError: %v", parsedCheck, parsedNotify, err)
-				}
-			}
-		}
-
-	return nil
-}
-
-func (r *runner) runCheckNotify(t Template, parsedCheck string, parsedNotify string) error {
-	var err error
-
-	checkCmd := ""
-	if parsedCheck != "" {
-		checkCmd = parsedCheck
-	} else {
-		checkCmd = t.CheckCmd
+		// No target selector - check/notify run once against the full context
+		return r.runCheckNotify(t, ctx, "")
 	}
 
-	if checkCmd != "" {
-		command := strings.Replace(checkCmd, "{{staging}}", t.Staging, -1)
-		if err := check(command); err != nil {
-			return fmt.Errorf("Check command failed: %v", err)
-		}
+	// NotifyLbl is a template expression (whereLabel/whereService/whereHost/
+	// whereState over ctx) selecting an arbitrary set of Container/Service/
+	// Host targets to run check/notify against individually.
+	targets, err := getNotifyTargets(ctx, t.NotifyLbl)
+	if err != nil {
+		return err
 	}
 
-	notifyCmd := ""
-	if parsedNotify != "" {
-		notifyCmd = parsedNotify
-	} else {
-		notifyCmd = t.NotifyCmd
-	}
+	var errs *multierror.Error
+	for _, target := range targets {
+		name := targetName(target)
+		log.Debugf("Notifying target: %+v", name)
 
-	if notifyCmd != "" {
-		if err := notify(notifyCmd, t.NotifyOutput); err != nil {
-			return fmt.Errorf("Notify command failed: %v", err)
+		if err := r.runCheckNotify(t, target, name); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("Check/notify failed for target %s: %v", name, err))
 		}
 	}
 
-	return err
+	return errs.ErrorOrNil()
 }
 
-func (r *runner) getLabelGroup(label string) ([]Container, error){
-	nLabelName, nLabelValue := "", ""
-	toNotify := []Container{} // may be more than just Containers in the future
-
-	if label == "" {
-		return nil, fmt.Errorf("NotifyLabelGroup failed: no label specified")
+// runCheckNotify renders CheckCmd/NotifyCmd as text/template against
+// target (a Container, Service, Host, or the full TemplateContext for the
+// unlabeled case) and runs them, reporting failures tagged with name for
+// structured logging.
+func (r *runner) runCheckNotify(t Template, target interface{}, name string) error {
+	checkCmd, err := renderCmdTemplate(target, t.CheckCmd, t.Staging)
+	if err != nil {
+		return fmt.Errorf("Could not render check command: %v", err)
 	}
 
-	split := strings.Split(label, ":")
-	nLabelName = split[0]
-
-	// Handle labels with and without values
-	if len(split) > 1 {
-		nLabelValue = split[1]
-		log.Debugf("Notifying label '%v' with value '%v'", nLabelName, nLabelValue)
-	} else {
-		log.Debugf("Notifying label '%s'", nLabelName)
+	if checkCmd != "" {
+		start := time.Now()
+		if err := check(checkCmd, t.Timeout); err != nil {
+			logTemplateEvent("check_failed", t, name, time.Since(start), exitCode(err), err)
+			return fmt.Errorf("Check command failed: %v", err)
+		}
 	}
 
-	// Populate `ctx` with system metadata
-	ctx, err := r.createContext()
+	notifyCmd, err := renderCmdTemplate(target, t.NotifyCmd, t.Staging)
 	if err != nil {
-		time.Sleep(time.Second * 2)
-		return nil, fmt.Errorf("Failed to create context from Rancher Metadata: %v", err)
-	}
-
-	// Search Services?
-	// Search Hosts?
-	// Search Containers:
-	for _, c := range ctx.Containers {
-		for lbl, val := range c.Labels {
-			if lbl == nLabelName {
-				if (nLabelValue == "") || (val == nLabelValue) {
-					log.Debugf("NOTIFY: %+v :: [%+v:%+v]", c.Name, lbl, val)
-					toNotify = append(toNotify, c)
-				}
-			}
-		}
+		return fmt.Errorf("Could not render notify command: %v", err)
 	}
 
-	return toNotify, err;
-}
-
-func parseCmdTemplate(c Container, command string) (string, error) {
-	ret := command
-  reg, _ := regexp.Compile(`{{[\w\.]*}}`)
-  matches := reg.FindAll( []byte(ret), -1)
-	cStruct := structs.New(c)
-
-  for _, match := range matches {
-    key := strings.Trim(string(match), "{}")
-		if strings.Index(key, ".") == 0{
-			key = strings.Replace(key, ".", "", 1)
-		}
-
-		if strings.Contains(key, "Labels.") {
-			labelParts := strings.SplitAfterN(key, ".", 2)
-			label := labelParts[len(labelParts)-1]
-			ret = strings.Replace(ret, string(match), c.Labels[label], -1)
-		} else {
-			// First check to see if key is a field in this struct
-			for _, f := range cStruct.Fields(){
-				if f.Name() == key{
-					val, _ := cStruct.Field(key).Value().(string)
-					ret = strings.Replace(ret, string(match), val, -1)
-				}
-			}
+	if notifyCmd != "" {
+		start := time.Now()
+		if err := notify(notifyCmd, t.NotifyOutput, t.Timeout); err != nil {
+			logTemplateEvent("notify_failed", t, name, time.Since(start), exitCode(err), err)
+			return fmt.Errorf("Notify command failed: %v", err)
 		}
-  }
+	}
 
-	return ret, nil
+	return nil
 }
 
 func copyStagingToDestination(stagingPath, destPath string) error {
@@ -351,83 +546,23 @@ func copyStagingToDestination(stagingPath, destPath string) error {
 func (r *runner) createContext() (*TemplateContext, error) {
 	log.Debug("Fetching Metadata")
 
-	metaServices, err := r.Client.GetServices()
+	services, err := r.Provider.GetServices()
 	if err != nil {
 		return nil, err
 	}
-	metaContainers, err := r.Client.GetContainers()
+	containers, err := r.Provider.GetContainers()
 	if err != nil {
 		return nil, err
 	}
-	metaHosts, err := r.Client.GetHosts()
+	hosts, err := r.Provider.GetHosts()
 	if err != nil {
 		return nil, err
 	}
-	metaSelf, err := r.Client.GetSelfContainer()
+	self, err := r.Provider.GetSelfContainer()
 	if err != nil {
 		return nil, err
 	}
 
-	hosts := make([]Host, 0)
-	for _, h := range metaHosts {
-		host := Host{
-			UUID:     h.UUID,
-			Name:     h.Name,
-			Address:  h.AgentIP,
-			Hostname: h.Hostname,
-			Labels:   LabelMap(h.Labels),
-		}
-		hosts = append(hosts, host)
-	}
-
-	containers := make([]Container, 0)
-	for _, c := range metaContainers {
-		container := Container{
-			Name:    c.Name,
-			Address: c.PrimaryIp,
-			Stack:   c.StackName,
-			Service: c.ServiceName,
-			Health:  c.HealthState,
-			State:   c.State,
-			Labels:  LabelMap(c.Labels),
-		}
-		for _, h := range hosts {
-			if h.UUID == c.HostUUID {
-				container.Host = h
-				break
-			}
-		}
-		containers = append(containers, container)
-	}
-
-	services := make([]Service, 0)
-	for _, s := range metaServices {
-		service := Service{
-			Name:     s.Name,
-			Stack:    s.StackName,
-			Kind:     s.Kind,
-			Vip:      s.Vip,
-			Fqdn:     s.Fqdn,
-			Labels:   LabelMap(s.Labels),
-			Metadata: MetadataMap(s.Metadata),
-		}
-		svcContainers := make([]Container, 0)
-		for _, c := range containers {
-			if c.Stack == s.StackName && c.Service == s.Name {
-				svcContainers = append(svcContainers, c)
-			}
-		}
-		service.Containers = svcContainers
-		service.Ports = parseServicePorts(s.Ports)
-		services = append(services, service)
-	}
-
-	self := Self{
-		Stack:    metaSelf.StackName,
-		Service:  metaSelf.ServiceName,
-		HostUUID: metaSelf.HostUUID,
-	}
-
 	ctx := TemplateContext{
 		Services:   services,
 		Containers: containers,
@@ -459,15 +594,35 @@ func parseServicePorts(ports []string) []ServicePort {
 	return ret
 }
 
-func check(command string) error {
+// commandContext builds the context a check/notify command runs under. A
+// non-positive timeout means "no deadline", preserving prior behavior for
+// templates that don't opt into one.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.Background(), func() {}
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func check(command string, timeout time.Duration) error {
 	//command = strings.Replace(command, "{{staging}}", filePath, -1)
 	log.Debugf("Running check command '%s'", command)
-	cmd := exec.Command("/bin/sh", "-c", command)
+	start := time.Now()
+	defer func() { checkDuration.Observe(time.Since(start).Seconds()) }()
+
+	ctx, cancel := commandContext(timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
 	out, err := cmd.CombinedOutput()
 
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Check command timed out after %s: %s", timeout, command)
+	}
 	if err != nil {
-		log.Printf("Check failed, skipping notify-cmd");
-		logCmdOutput(command, out)
+		log.Printf("Check failed, skipping notify-cmd")
+		logCmdOutput(command, out, exitCode(err))
 		return err
 	}
 
@@ -475,31 +630,67 @@ func check(command string) error {
 	return nil
 }
 
-func notify(command string, verbose bool) error {
+func notify(command string, verbose bool, timeout time.Duration) error {
 	log.Infof("Executing notify command '%s'", command)
-	cmd := exec.Command("/bin/sh", "-c", command)
+	start := time.Now()
+	defer func() { notifyDuration.Observe(time.Since(start).Seconds()) }()
+
+	ctx, cancel := commandContext(timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
 	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Notify command timed out after %s: %s", timeout, command)
+	}
 	if err != nil {
-		logCmdOutput(command, out)
+		logCmdOutput(command, out, exitCode(err))
 		return err
 	}
 
 	if verbose {
-		logCmdOutput(command, out)
+		logCmdOutput(command, out, 0)
 	}
 
 	log.Debugf("Notify cmd output: %q", string(out))
 	return nil
 }
 
-func logCmdOutput(command string, output []byte) {
+// logCmdOutput emits each line of check/notify command output as a
+// structured entry (command, exit_code fields) instead of plain text, so
+// it can be filtered and alerted on once shipped through the hooks
+// ConfigureLogging wires up.
+func logCmdOutput(command string, output []byte, code int) {
 	for _, line := range strings.Split(string(output), "\n") {
 		if line != "" {
-			log.Infof("[%s]: %q", command, line)
+			log.WithFields(log.Fields{
+				"command":   command,
+				"exit_code": code,
+			}).Info(line)
 		}
 	}
 }
 
+// exitCode pulls the process exit status out of an exec error, defaulting
+// to -1 when it isn't an *exec.ExitError (e.g. the command never started).
+func exitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+
+	return -1
+}
+
+// checksumOf returns the hex-encoded md5 of content, the same checksum
+// format sameContent compares against, for reporting over /templates.
+func checksumOf(content []byte) string {
+	hash := md5.New()
+	hash.Write(content)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
 func sameContent(content []byte, filePath string) (bool, error) {
 	fileMd5, err := computeFileMd5(filePath)
 	if err != nil {
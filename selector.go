@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// getNotifyTargets evaluates expr - a NotifyLbl value, e.g.
+// `whereState (whereLabel .Containers "io.rancher.foo" "") "running"` - as a
+// text/template expression against ctx and returns whatever the where*
+// helpers below selected. The where* funcs close over `targets` as a side
+// effect rather than relying on the rendered output.
+func getNotifyTargets(ctx *TemplateContext, expr string) ([]interface{}, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("NotifyLbl evaluation failed: no expression specified")
+	}
+
+	var targets []interface{}
+
+	funcs := template.FuncMap{
+		"whereLabel": func(items interface{}, key string, value string) []interface{} {
+			targets = whereLabel(items, key, value)
+			return targets
+		},
+		"whereService": func(items interface{}, name string) []interface{} {
+			targets = whereService(items, name)
+			return targets
+		},
+		"whereHost": func(items interface{}, uuid string) []interface{} {
+			targets = whereHost(items, uuid)
+			return targets
+		},
+		"whereState": func(items interface{}, state string) []interface{} {
+			targets = whereState(items, state)
+			return targets
+		},
+	}
+
+	tmpl, err := template.New("notify-lbl").Funcs(funcs).Parse("{{" + expr + "}}")
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse NotifyLbl expression %q: %v", expr, err)
+	}
+
+	if err := tmpl.Execute(new(bytes.Buffer), ctx); err != nil {
+		return nil, fmt.Errorf("Could not evaluate NotifyLbl expression %q: %v", expr, err)
+	}
+
+	if targets == nil {
+		log.Warnf("NotifyLbl expression %q never called whereLabel/whereService/whereHost/whereState; check/notify will not run for this template", expr)
+	}
+
+	return targets, nil
+}
+
+// asTargets normalizes the first argument of a where* call - which may be
+// the typed slice straight off TemplateContext ([]Container, []Service,
+// []Host) or the []interface{} produced by a nested where* call - into a
+// single []interface{} so the filters below only need one code path.
+func asTargets(items interface{}) []interface{} {
+	switch v := items.(type) {
+	case []Container:
+		out := make([]interface{}, len(v))
+		for i, c := range v {
+			out[i] = c
+		}
+		return out
+	case []Service:
+		out := make([]interface{}, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	case []Host:
+		out := make([]interface{}, len(v))
+		for i, h := range v {
+			out[i] = h
+		}
+		return out
+	case []interface{}:
+		return v
+	default:
+		return nil
+	}
+}
+
+func targetLabels(target interface{}) LabelMap {
+	switch t := target.(type) {
+	case Container:
+		return t.Labels
+	case Service:
+		return t.Labels
+	case Host:
+		return t.Labels
+	default:
+		return nil
+	}
+}
+
+// whereLabel filters to targets carrying label key, optionally restricted
+// to a specific value ("" matches any value for that key).
+func whereLabel(items interface{}, key string, value string) []interface{} {
+	out := []interface{}{}
+	for _, target := range asTargets(items) {
+		val, ok := targetLabels(target)[key]
+		if ok && (value == "" || val == value) {
+			out = append(out, target)
+		}
+	}
+
+	return out
+}
+
+// whereService filters Containers to those belonging to the named service.
+func whereService(items interface{}, name string) []interface{} {
+	out := []interface{}{}
+	for _, target := range asTargets(items) {
+		if c, ok := target.(Container); ok && c.Service == name {
+			out = append(out, target)
+		}
+	}
+
+	return out
+}
+
+// whereHost filters Containers running on, or Hosts matching, uuid.
+func whereHost(items interface{}, uuid string) []interface{} {
+	out := []interface{}{}
+	for _, target := range asTargets(items) {
+		switch t := target.(type) {
+		case Container:
+			if t.Host.UUID == uuid {
+				out = append(out, target)
+			}
+		case Host:
+			if t.UUID == uuid {
+				out = append(out, target)
+			}
+		}
+	}
+
+	return out
+}
+
+// whereState filters Containers to those in the given state (e.g. "running").
+func whereState(items interface{}, state string) []interface{} {
+	out := []interface{}{}
+	for _, target := range asTargets(items) {
+		if c, ok := target.(Container); ok && c.State == state {
+			out = append(out, target)
+		}
+	}
+
+	return out
+}
+
+// targetName extracts the display name of a selected target for logging,
+// regardless of which of the three concrete types it is.
+func targetName(target interface{}) string {
+	switch t := target.(type) {
+	case Container:
+		return t.Name
+	case Service:
+		return t.Name
+	case Host:
+		return t.Name
+	default:
+		return fmt.Sprintf("%v", target)
+	}
+}
+
+// renderCmdTemplate parses cmdTmpl as a text/template and executes it with
+// target as "." - so CheckCmd/NotifyCmd can reference {{.Host.Address}},
+// {{index .Labels "io.rancher.foo"}}, and so on - plus a `staging` function
+// for the existing staging-file placeholder. Replaces the old regexp +
+// fatih/structs field-substitution hack.
+func renderCmdTemplate(target interface{}, cmdTmpl string, stagingFile string) (string, error) {
+	if cmdTmpl == "" {
+		return "", nil
+	}
+
+	funcs := template.FuncMap{
+		"staging": func() string { return stagingFile },
+	}
+
+	tmpl, err := template.New("cmd").Funcs(funcs).Parse(cmdTmpl)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse command template %q: %v", cmdTmpl, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, target); err != nil {
+		return "", fmt.Errorf("Could not render command template %q: %v", cmdTmpl, err)
+	}
+
+	return buf.String(), nil
+}
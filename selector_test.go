@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestWhereLabel(t *testing.T) {
+	items := []Container{
+		{Name: "a", Labels: LabelMap{"io.rancher.foo": "bar"}},
+		{Name: "b", Labels: LabelMap{"io.rancher.foo": "baz"}},
+		{Name: "c", Labels: LabelMap{}},
+	}
+
+	out := whereLabel(items, "io.rancher.foo", "")
+	if len(out) != 2 {
+		t.Fatalf("whereLabel with no value = %d results, want 2", len(out))
+	}
+
+	out = whereLabel(items, "io.rancher.foo", "bar")
+	if len(out) != 1 || out[0].(Container).Name != "a" {
+		t.Fatalf("whereLabel with value = %+v, want just %q", out, "a")
+	}
+}
+
+func TestWhereService(t *testing.T) {
+	items := []Container{
+		{Name: "a", Service: "web"},
+		{Name: "b", Service: "db"},
+	}
+
+	out := whereService(items, "web")
+	if len(out) != 1 || out[0].(Container).Name != "a" {
+		t.Fatalf("whereService = %+v, want just %q", out, "a")
+	}
+}
+
+func TestWhereHost(t *testing.T) {
+	containers := []Container{
+		{Name: "a", Host: Host{UUID: "uuid-1"}},
+		{Name: "b", Host: Host{UUID: "uuid-2"}},
+	}
+	out := whereHost(containers, "uuid-1")
+	if len(out) != 1 || out[0].(Container).Name != "a" {
+		t.Fatalf("whereHost over Containers = %+v, want just %q", out, "a")
+	}
+
+	hosts := []Host{
+		{Name: "host-a", UUID: "uuid-1"},
+		{Name: "host-b", UUID: "uuid-2"},
+	}
+	out = whereHost(hosts, "uuid-2")
+	if len(out) != 1 || out[0].(Host).Name != "host-b" {
+		t.Fatalf("whereHost over Hosts = %+v, want just %q", out, "host-b")
+	}
+}
+
+func TestWhereState(t *testing.T) {
+	items := []Container{
+		{Name: "a", State: "running"},
+		{Name: "b", State: "stopped"},
+	}
+
+	out := whereState(items, "running")
+	if len(out) != 1 || out[0].(Container).Name != "a" {
+		t.Fatalf("whereState = %+v, want just %q", out, "a")
+	}
+}
+
+func TestWhereFiltersChain(t *testing.T) {
+	items := []Container{
+		{Name: "a", State: "running", Labels: LabelMap{"io.rancher.foo": ""}},
+		{Name: "b", State: "stopped", Labels: LabelMap{"io.rancher.foo": ""}},
+	}
+
+	out := whereState(whereLabel(items, "io.rancher.foo", ""), "running")
+	if len(out) != 1 || out[0].(Container).Name != "a" {
+		t.Fatalf("chained where* = %+v, want just %q", out, "a")
+	}
+}